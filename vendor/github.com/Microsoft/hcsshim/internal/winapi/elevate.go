@@ -0,0 +1,35 @@
+//go:build windows
+
+package winapi
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsElevated returns true if the current process' token is elevated.
+func IsElevated() bool {
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_QUERY, &token); err != nil {
+		return false
+	}
+	defer token.Close()
+
+	var elevation struct {
+		TokenIsElevated uint32
+	}
+	var returnedLen uint32
+	err := windows.GetTokenInformation(
+		token,
+		windows.TokenElevation,
+		(*byte)(unsafe.Pointer(&elevation)),
+		uint32(unsafe.Sizeof(elevation)),
+		&returnedLen,
+	)
+	if err != nil {
+		return false
+	}
+
+	return elevation.TokenIsElevated != 0
+}
@@ -1,44 +1,340 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Microsoft/hcsshim/internal/hcs"
+	"github.com/Microsoft/hcsshim/internal/hcsschema"
 	"github.com/Microsoft/hcsshim/internal/uvm"
+	"github.com/Microsoft/hcsshim/internal/winapi"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
 const (
-	kernelArgsArgName           = "kernel-args"
-	rootFSTypeArgName           = "root-fs-type"
-	vpMemMaxCountArgName        = "vpmem-max-count"
-	vpMemMaxSizeArgName         = "vpmem-max-size"
-	cpusArgName                 = "cpus"
-	memoryArgName               = "memory"
-	allowOvercommitArgName      = "allow-overcommit"
-	enableDeferredCommitArgName = "enable-deferred-commit"
-	measureArgName              = "measure"
-	parallelArgName             = "parallel"
-	countArgName                = "count"
-	kernelDirectArgName         = "kernel-direct"
-	execCommandLineArgName      = "exec"
-	forwardStdoutArgName        = "fwd-stdout"
-	forwardStderrArgName        = "fwd-stderr"
-	debugArgName                = "debug"
-	outputHandlingArgName       = "output-handling"
+	kernelArgsArgName               = "kernel-args"
+	rootFSTypeArgName               = "root-fs-type"
+	vpMemMaxCountArgName            = "vpmem-max-count"
+	vpMemMaxSizeArgName             = "vpmem-max-size"
+	cpusArgName                     = "cpus"
+	memoryArgName                   = "memory"
+	allowOvercommitArgName          = "allow-overcommit"
+	enableDeferredCommitArgName     = "enable-deferred-commit"
+	measureArgName                  = "measure"
+	measureFormatArgName            = "measure-format"
+	parallelArgName                 = "parallel"
+	countArgName                    = "count"
+	kernelDirectArgName             = "kernel-direct"
+	execCommandLineArgName          = "exec"
+	forwardStdoutArgName            = "fwd-stdout"
+	forwardStderrArgName            = "fwd-stderr"
+	debugArgName                    = "debug"
+	outputHandlingArgName           = "output-handling"
+	bootFilesPathArgName            = "boot-files-path"
+	kernelFileArgName               = "kernel-file"
+	mountSCSIArgName                = "mount-scsi"
+	shareArgName                    = "share"
+	layerFolderArgName              = "layer-folder"
+	scratchFolderArgName            = "scratch-folder"
+	securityPolicyArgName           = "security-policy"
+	securityPolicyEnforcerArgName   = "security-policy-enforcer"
+	securityHardwareIsolatedArgName = "security-hardware-isolated"
+	disableTimeSyncArgName          = "disable-time-sync"
+	consolePipeArgName              = "console-pipe"
+	ttyArgName                      = "tty"
 )
 
+// maxMountedSCSIDisks is the number of disks the UVM's SCSI controllers can
+// expose at once; it bounds how many --mount-scsi flags may be given.
+const maxMountedSCSIDisks = uvm.MaxSCSIControllers * uvm.MaxAttachmentsPerScsiController
+
+// scsiMount describes a single --mount-scsi flag value:
+// host_path[:uvm_path[:readonly]].
+type scsiMount struct {
+	hostPath string
+	uvmPath  string
+	readOnly bool
+}
+
+// shareMount describes a single --share flag value: host_dir:uvm_dir[:readonly].
+type shareMount struct {
+	hostPath string
+	uvmPath  string
+	readOnly bool
+}
+
+// driveLetterPrefix matches a leading Windows drive letter, e.g. the "C:"
+// in `C:\data\disk.vhdx`. That colon is part of the path, not a
+// host_path[:uvm_path[:readonly]] field separator; a bare colon can't
+// appear anywhere else in a Windows path, so stripping this prefix before
+// splitting on ":" is enough to parse drive-letter paths correctly.
+var driveLetterPrefix = regexp.MustCompile(`^[a-zA-Z]:`)
+
+// splitMountFields splits a host_path[:uvm_path[:readonly]] flag value into
+// at most n colon-separated fields, treating a leading Windows drive letter
+// in host_path as part of the path rather than the first separator.
+func splitMountFields(s string, n int) []string {
+	prefix := driveLetterPrefix.FindString(s)
+	parts := strings.SplitN(s[len(prefix):], ":", n)
+	parts[0] = prefix + parts[0]
+	return parts
+}
+
+func parseSCSIMount(s string) (scsiMount, error) {
+	parts := splitMountFields(s, 3)
+	if parts[0] == "" {
+		return scsiMount{}, fmt.Errorf("invalid %s value %q: host_path must not be empty", mountSCSIArgName, s)
+	}
+	m := scsiMount{hostPath: parts[0]}
+	if len(parts) > 1 {
+		m.uvmPath = parts[1]
+	}
+	if len(parts) > 2 {
+		ro, err := strconv.ParseBool(parts[2])
+		if err != nil {
+			return scsiMount{}, fmt.Errorf("invalid %s value %q: readonly must be a bool: %s", mountSCSIArgName, s, err)
+		}
+		m.readOnly = ro
+	}
+	return m, nil
+}
+
+func parseShare(s string) (shareMount, error) {
+	parts := splitMountFields(s, 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return shareMount{}, fmt.Errorf("invalid %s value %q: must be host_dir:uvm_dir[:readonly]", shareArgName, s)
+	}
+	m := shareMount{hostPath: parts[0], uvmPath: parts[1]}
+	if len(parts) > 2 {
+		ro, err := strconv.ParseBool(parts[2])
+		if err != nil {
+			return shareMount{}, fmt.Errorf("invalid %s value %q: readonly must be a bool: %s", shareArgName, s, err)
+		}
+		m.readOnly = ro
+	}
+	return m, nil
+}
+
+// phaseTimings records the wall clock duration of each phase of a single
+// UVM's boot, in milliseconds.
+type phaseTimings struct {
+	CreateMS float64 `json:"create_ms"`
+	StartMS  float64 `json:"start_ms"`
+	ExecMS   float64 `json:"exec_ms,omitempty"`
+	WaitMS   float64 `json:"wait_ms"`
+}
+
+// bootTiming is the JSON shape emitted per run when --measure-format=json.
+type bootTiming struct {
+	UVMID  string       `json:"uvm_id"`
+	Phases phaseTimings `json:"phases"`
+}
+
+// phaseSummary holds aggregate statistics for a single phase across every
+// UVM booted in a --measure-format=json run.
+type phaseSummary struct {
+	MinMS    float64 `json:"min_ms"`
+	MedianMS float64 `json:"median_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	P99MS    float64 `json:"p99_ms"`
+	MaxMS    float64 `json:"max_ms"`
+}
+
+// bootSummary is the final JSON object emitted after a --measure-format=json
+// run, aggregating per-phase timings across all UVMs booted. Exec is a
+// pointer, omitted entirely when no run in the batch used --tty (which
+// requires --exec; --exec alone is not timed separately), so "no data"
+// isn't indistinguishable from a real all-zero measurement.
+type bootSummary struct {
+	Count  int           `json:"count"`
+	Create phaseSummary  `json:"create_ms"`
+	Start  phaseSummary  `json:"start_ms"`
+	Exec   *phaseSummary `json:"exec_ms,omitempty"`
+	Wait   phaseSummary  `json:"wait_ms"`
+}
+
+func summarize(values []float64) phaseSummary {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	percentile := func(p float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		pos := p * float64(len(sorted)-1)
+		lower := int(pos)
+		if lower == len(sorted)-1 {
+			return sorted[lower]
+		}
+		frac := pos - float64(lower)
+		return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+	}
+
+	return phaseSummary{
+		MinMS:    percentile(0),
+		MedianMS: percentile(0.5),
+		P95MS:    percentile(0.95),
+		P99MS:    percentile(0.99),
+		MaxMS:    percentile(1),
+	}
+}
+
+// runPool runs create up to c.GlobalInt(countArgName) times, using
+// c.GlobalInt(parallelArgName) workers at once. When --measure is set, it
+// prints either the total wall clock time of the run (--measure-format
+// human, the default) or, with --measure-format json, the per-phase timings
+// of every UVM plus a final aggregate summary. create is handed a unique id
+// for each UVM and is responsible for that UVM's entire lifetime: creating
+// it, starting it, and tearing it down.
+func runPool(c *cli.Context, create func(id string) (phaseTimings, error)) {
+	parallelCount := c.GlobalInt(parallelArgName)
+	measure := c.GlobalBool(measureArgName)
+	jsonFormat := strings.EqualFold(c.GlobalString(measureFormatArgName), "json")
+
+	var wg sync.WaitGroup
+	wg.Add(parallelCount)
+
+	workChan := make(chan int)
+
+	var timingsMu sync.Mutex
+	var timings []phaseTimings
+
+	runFunc := func(workChan <-chan int) {
+		for {
+			i, ok := <-workChan
+
+			if !ok {
+				wg.Done()
+				return
+			}
+
+			id := fmt.Sprintf("uvmboot-%d", i)
+
+			t, err := create(id)
+			if err != nil {
+				logrus.WithField("uvm-id", id).Error(err)
+				continue
+			}
+
+			if measure {
+				if jsonFormat {
+					data, err := json.Marshal(bootTiming{UVMID: id, Phases: t})
+					if err != nil {
+						logrus.WithField("uvm-id", id).Error(err)
+					} else {
+						fmt.Println(string(data))
+					}
+				}
+				timingsMu.Lock()
+				timings = append(timings, t)
+				timingsMu.Unlock()
+			}
+		}
+	}
+
+	for i := 0; i < parallelCount; i++ {
+		go runFunc(workChan)
+	}
+
+	start := time.Now()
+
+	for i := 0; i < c.GlobalInt(countArgName); i++ {
+		workChan <- i
+	}
+
+	close(workChan)
+
+	wg.Wait()
+
+	if !measure {
+		return
+	}
+
+	if !jsonFormat {
+		fmt.Println("Elapsed time:", time.Since(start))
+		return
+	}
+
+	if len(timings) == 0 {
+		return
+	}
+
+	createMS := make([]float64, len(timings))
+	startMS := make([]float64, len(timings))
+	var execMS []float64
+	waitMS := make([]float64, len(timings))
+	for i, t := range timings {
+		createMS[i] = t.CreateMS
+		startMS[i] = t.StartMS
+		waitMS[i] = t.WaitMS
+		// ExecMS is only populated when --tty (with --exec) was used; leaving
+		// the rest at their zero value would pad the exec_ms summary
+		// with structural zeros for ordinary runs.
+		if t.ExecMS > 0 {
+			execMS = append(execMS, t.ExecMS)
+		}
+	}
+
+	summary := bootSummary{
+		Count:  len(timings),
+		Create: summarize(createMS),
+		Start:  summarize(startMS),
+		Wait:   summarize(waitMS),
+	}
+	if len(execMS) > 0 {
+		s := summarize(execMS)
+		summary.Exec = &s
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// errMustBeElevated is returned when uvmboot is not run from an elevated
+// (Administrator) process, since booting a UVM requires elevation and
+// otherwise fails deep inside HCS with an opaque error.
+var errMustBeElevated = errors.New("uvmboot must be run as Administrator")
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "uvmboot"
 	app.Usage = "Boot a utility VM"
 
+	// Before runs before any command's Action, so every command is covered
+	// by a single check instead of duplicating it per Action. It runs ahead
+	// of a subcommand's own --help handling too (urfave/cli only special-
+	// cases the top-level --help before dispatch), so a subcommand's
+	// --help/-h and the built-in "help" command (e.g. `uvmboot help lcow`)
+	// are recognized here and exempted as well.
+	app.Before = func(c *cli.Context) error {
+		if c.Args().First() == "help" {
+			return nil
+		}
+		for _, arg := range c.Args() {
+			if arg == "-h" || arg == "--help" {
+				return nil
+			}
+		}
+		if !winapi.IsElevated() {
+			return errMustBeElevated
+		}
+		return nil
+	}
+
 	app.Flags = []cli.Flag{
 		cli.Uint64Flag{
 			Name:  cpusArgName,
@@ -52,6 +348,11 @@ func main() {
 			Name:  measureArgName,
 			Usage: "Measure wall clock time of the UVM run",
 		},
+		cli.StringFlag{
+			Name:  measureFormatArgName,
+			Value: "human",
+			Usage: "Format for --measure output: 'human' or 'json'. With 'json', per-phase timings are recorded for each UVM",
+		},
 		cli.IntFlag{
 			Name:  parallelArgName,
 			Value: 1,
@@ -118,126 +419,266 @@ func main() {
 					Name:  outputHandlingArgName,
 					Usage: "Controls how output from UVM is handled. Use 'stdout' to print all output to stdout",
 				},
+				cli.StringFlag{
+					Name:  bootFilesPathArgName,
+					Usage: "Path to the directory containing the kernel and root FS. Uses hcsshim default if not specified",
+				},
+				cli.StringFlag{
+					Name:  kernelFileArgName,
+					Value: "kernel",
+					Usage: "Name of the kernel file to boot with when using kernel direct boot: 'kernel' or 'vmlinux'",
+				},
+				cli.StringSliceFlag{
+					Name:  mountSCSIArgName,
+					Usage: "Attach a VHD/VHDX to the UVM over SCSI: host_path[:uvm_path[:readonly]]. May be given multiple times",
+				},
+				cli.StringSliceFlag{
+					Name:  shareArgName,
+					Usage: "Share a host directory into the UVM: host_dir:uvm_dir[:readonly]. May be given multiple times",
+				},
+				cli.StringFlag{
+					Name:  securityPolicyArgName,
+					Usage: "Base64 encoded security policy (rego) to apply to the UVM",
+				},
+				cli.StringFlag{
+					Name:  securityPolicyEnforcerArgName,
+					Value: "standard",
+					Usage: "Security policy enforcer to use: 'rego' or 'standard'",
+				},
+				cli.BoolFlag{
+					Name:  securityHardwareIsolatedArgName,
+					Usage: "Boot the UVM as hardware isolated (SNP) for confidential containers",
+				},
+				cli.BoolFlag{
+					Name:  disableTimeSyncArgName,
+					Usage: "Disable the time synchronization service in the UVM",
+				},
+				cli.StringFlag{
+					Name:  consolePipeArgName,
+					Usage: `Named pipe (\\.\pipe\name) to wire up as the UVM's COM1 serial console`,
+				},
+				cli.BoolFlag{
+					Name:  ttyArgName,
+					Usage: "Attach the host terminal to the exec'd process' stdio, for an interactive session. Requires --exec",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				if c.GlobalBool("debug") {
 					logrus.SetLevel(logrus.DebugLevel)
 				}
 
-				parallelCount := c.GlobalInt(parallelArgName)
-
-				var wg sync.WaitGroup
-				wg.Add(parallelCount)
-
-				workChan := make(chan int)
-
-				runFunc := func(workChan <-chan int) {
-					for {
-						i, ok := <-workChan
+				if c.Bool(ttyArgName) {
+					if !c.IsSet(execCommandLineArgName) {
+						return fmt.Errorf("--%s requires --%s", ttyArgName, execCommandLineArgName)
+					}
+					if c.GlobalInt(parallelArgName) > 1 || c.GlobalInt(countArgName) > 1 {
+						return fmt.Errorf("--%s cannot be used with --%s/--%s greater than 1: all UVMs would share the host's stdin", ttyArgName, parallelArgName, countArgName)
+					}
+					if c.IsSet(consolePipeArgName) {
+						return fmt.Errorf("--%s cannot be used with --%s: the interactive process' stdio is carried over the GCS guest connection, not the serial console", ttyArgName, consolePipeArgName)
+					}
+				}
 
-						if !ok {
-							wg.Done()
-							return
-						}
+				var scsiMounts []scsiMount
+				for _, s := range c.StringSlice(mountSCSIArgName) {
+					m, err := parseSCSIMount(s)
+					if err != nil {
+						return err
+					}
+					scsiMounts = append(scsiMounts, m)
+				}
+				if len(scsiMounts) > maxMountedSCSIDisks {
+					return fmt.Errorf("%d %s entries given, but the UVM only supports %d SCSI-attached disks", len(scsiMounts), mountSCSIArgName, maxMountedSCSIDisks)
+				}
 
-						id := fmt.Sprintf("uvmboot-%d", i)
+				var shares []shareMount
+				for _, s := range c.StringSlice(shareArgName) {
+					m, err := parseShare(s)
+					if err != nil {
+						return err
+					}
+					shares = append(shares, m)
+				}
 
-						options := uvm.OptionsLCOW{
-							Options: &uvm.Options{
-								ID: id,
-							},
-						}
+				runPool(c, func(id string) (phaseTimings, error) {
+					options := uvm.OptionsLCOW{
+						Options: &uvm.Options{
+							ID: id,
+						},
+					}
 
-						{
-							val := false
-							options.UseGuestConnection = &val
-						}
+					{
+						// --tty drives the exec'd process through CreateProcess
+						// over the GCS guest connection (see runInteractive), so
+						// the guest connection can't be disabled in that mode;
+						// otherwise leave it off since ExecCommandLine/console
+						// output don't need it.
+						val := c.Bool(ttyArgName)
+						options.UseGuestConnection = &val
+					}
 
-						if c.GlobalIsSet(cpusArgName) {
-							options.ProcessorCount = int32(c.GlobalUint64(cpusArgName))
-						}
-						if c.GlobalIsSet(memoryArgName) {
-							options.MemorySizeInMB = int32(c.GlobalUint64(memoryArgName))
-						}
-						if c.GlobalIsSet(allowOvercommitArgName) {
-							val := c.GlobalBool(allowOvercommitArgName)
-							options.AllowOvercommit = &val
-						}
-						if c.GlobalIsSet(enableDeferredCommitArgName) {
-							val := c.GlobalBool(enableDeferredCommitArgName)
-							options.EnableDeferredCommit = &val
-						}
+					if c.GlobalIsSet(cpusArgName) {
+						options.ProcessorCount = int32(c.GlobalUint64(cpusArgName))
+					}
+					if c.GlobalIsSet(memoryArgName) {
+						options.MemorySizeInMB = int32(c.GlobalUint64(memoryArgName))
+					}
+					if c.GlobalIsSet(allowOvercommitArgName) {
+						val := c.GlobalBool(allowOvercommitArgName)
+						options.AllowOvercommit = &val
+					}
+					if c.GlobalIsSet(enableDeferredCommitArgName) {
+						val := c.GlobalBool(enableDeferredCommitArgName)
+						options.EnableDeferredCommit = &val
+					}
 
-						if c.IsSet(kernelDirectArgName) {
-							options.KernelDirect = c.Bool(kernelDirectArgName)
-						}
-						if c.IsSet(rootFSTypeArgName) {
-							switch strings.ToLower(c.String(rootFSTypeArgName)) {
-							case "initrd":
-								val := uvm.PreferredRootFSTypeInitRd
-								options.PreferredRootFSType = &val
-							case "vhd":
-								val := uvm.PreferredRootFSTypeVHD
-								options.PreferredRootFSType = &val
-							default:
-								logrus.Fatalf("Unrecognized value '%s' for option %s", c.String(rootFSTypeArgName), rootFSTypeArgName)
-							}
-						}
-						if c.IsSet(kernelArgsArgName) {
-							options.KernelBootOptions = c.String(kernelArgsArgName)
-						}
-						if c.IsSet(vpMemMaxCountArgName) {
-							val := uint32(c.Uint(vpMemMaxCountArgName))
-							options.VPMemDeviceCount = &val
-						}
-						if c.IsSet(vpMemMaxSizeArgName) {
-							val := c.Uint64(vpMemMaxSizeArgName) * 1024 * 1024 // convert from MB to bytes
-							options.VPMemSizeBytes = &val
-						}
-						if c.IsSet(execCommandLineArgName) {
-							options.ExecCommandLine = c.String(execCommandLineArgName)
-						}
-						if c.IsSet(forwardStdoutArgName) {
-							val := c.Bool(forwardStdoutArgName)
-							options.ForwardStdout = &val
+					if c.IsSet(kernelDirectArgName) {
+						options.KernelDirect = c.Bool(kernelDirectArgName)
+					}
+					if c.IsSet(rootFSTypeArgName) {
+						switch strings.ToLower(c.String(rootFSTypeArgName)) {
+						case "initrd":
+							val := uvm.PreferredRootFSTypeInitRd
+							options.PreferredRootFSType = &val
+						case "vhd":
+							val := uvm.PreferredRootFSTypeVHD
+							options.PreferredRootFSType = &val
+						default:
+							logrus.Fatalf("Unrecognized value '%s' for option %s", c.String(rootFSTypeArgName), rootFSTypeArgName)
 						}
-						if c.IsSet(forwardStderrArgName) {
-							val := c.Bool(forwardStderrArgName)
-							options.ForwardStderr = &val
+					}
+					if c.IsSet(kernelArgsArgName) {
+						options.KernelBootOptions = c.String(kernelArgsArgName)
+					}
+					if c.IsSet(vpMemMaxCountArgName) {
+						val := uint32(c.Uint(vpMemMaxCountArgName))
+						options.VPMemDeviceCount = &val
+					}
+					if c.IsSet(vpMemMaxSizeArgName) {
+						val := c.Uint64(vpMemMaxSizeArgName) * 1024 * 1024 // convert from MB to bytes
+						options.VPMemSizeBytes = &val
+					}
+					tty := c.Bool(ttyArgName)
+					if c.IsSet(execCommandLineArgName) && !tty {
+						// When --tty is set, run starts the exec'd process itself so it
+						// can wire up interactive stdio, instead of letting the UVM
+						// launch it automatically.
+						options.ExecCommandLine = c.String(execCommandLineArgName)
+					}
+					if c.IsSet(consolePipeArgName) {
+						options.ConsolePipe = c.String(consolePipeArgName)
+					}
+					if c.IsSet(forwardStdoutArgName) {
+						val := c.Bool(forwardStdoutArgName)
+						options.ForwardStdout = &val
+					}
+					if c.IsSet(forwardStderrArgName) {
+						val := c.Bool(forwardStderrArgName)
+						options.ForwardStderr = &val
+					}
+					if c.IsSet(outputHandlingArgName) {
+						switch strings.ToLower(c.String(outputHandlingArgName)) {
+						case "stdout":
+							val := uvm.OutputHandler(func(r io.Reader) { io.Copy(os.Stdout, r) })
+							options.OutputHandler = &val
+						default:
+							logrus.Fatalf("Unrecognized value '%s' for option %s", c.String(outputHandlingArgName), outputHandlingArgName)
 						}
-						if c.IsSet(outputHandlingArgName) {
-							switch strings.ToLower(c.String(outputHandlingArgName)) {
-							case "stdout":
-								val := uvm.OutputHandler(func(r io.Reader) { io.Copy(os.Stdout, r) })
-								options.OutputHandler = &val
-							default:
-								logrus.Fatalf("Unrecognized value '%s' for option %s", c.String(outputHandlingArgName), outputHandlingArgName)
-							}
+					}
+					if c.IsSet(bootFilesPathArgName) {
+						options.BootFilesPath = c.String(bootFilesPathArgName)
+					}
+					if c.IsSet(kernelFileArgName) {
+						switch strings.ToLower(c.String(kernelFileArgName)) {
+						case "kernel":
+							options.KernelFile = uvm.KernelFile
+						case "vmlinux":
+							options.KernelFile = uvm.UncompressedKernelFile
+						default:
+							logrus.Fatalf("Unrecognized value '%s' for option %s", c.String(kernelFileArgName), kernelFileArgName)
 						}
-
-						if err := run(&options); err != nil {
-							logrus.WithField("uvm-id", id).Error(err)
+					}
+					if c.IsSet(securityPolicyArgName) {
+						options.SecurityPolicy = c.String(securityPolicyArgName)
+					}
+					if c.IsSet(securityPolicyEnforcerArgName) {
+						switch strings.ToLower(c.String(securityPolicyEnforcerArgName)) {
+						case "rego":
+							options.SecurityPolicyEnforcer = "rego"
+						case "standard":
+							options.SecurityPolicyEnforcer = "standard"
+						default:
+							logrus.Fatalf("Unrecognized value '%s' for option %s", c.String(securityPolicyEnforcerArgName), securityPolicyEnforcerArgName)
 						}
 					}
-				}
-
-				for i := 0; i < parallelCount; i++ {
-					go runFunc(workChan)
-				}
+					if c.IsSet(securityPolicyArgName) {
+						options.SecurityPolicyEnabled = true
+					}
+					if c.IsSet(securityHardwareIsolatedArgName) {
+						options.IsHardwareIsolated = c.Bool(securityHardwareIsolatedArgName)
+					}
+					if c.IsSet(disableTimeSyncArgName) {
+						val := c.Bool(disableTimeSyncArgName)
+						options.DisableTimeSyncService = val
+					}
 
-				start := time.Now()
+					return run(&options, scsiMounts, shares, tty, c.String(execCommandLineArgName))
+				})
 
-				for i := 0; i < c.GlobalInt(countArgName); i++ {
-					workChan <- i
+				return nil
+			},
+		},
+		{
+			Name:  "wcow",
+			Usage: "Boot a WCOW UVM",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  layerFolderArgName,
+					Usage: "Path to a read-only parent layer folder, ordered from the base layer up. May be given multiple times",
+				},
+				cli.StringFlag{
+					Name:  scratchFolderArgName,
+					Usage: "Path to the scratch folder for the UVM's read-write layer; appended as the last, topmost entry of --layer-folder. Uses hcsshim default if not specified",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.GlobalBool("debug") {
+					logrus.SetLevel(logrus.DebugLevel)
 				}
 
-				close(workChan)
+				runPool(c, func(id string) (phaseTimings, error) {
+					// The UVM's read-write layer is conventionally the last
+					// entry of LayerFolders, so --scratch-folder is appended
+					// after the read-only layers from --layer-folder rather
+					// than set as a field of its own.
+					layerFolders := c.StringSlice(layerFolderArgName)
+					if c.IsSet(scratchFolderArgName) {
+						layerFolders = append(layerFolders, c.String(scratchFolderArgName))
+					}
+					options := uvm.OptionsWCOW{
+						Options: &uvm.Options{
+							ID: id,
+						},
+						LayerFolders: layerFolders,
+					}
 
-				wg.Wait()
+					if c.GlobalIsSet(cpusArgName) {
+						options.ProcessorCount = int32(c.GlobalUint64(cpusArgName))
+					}
+					if c.GlobalIsSet(memoryArgName) {
+						options.MemorySizeInMB = int32(c.GlobalUint64(memoryArgName))
+					}
+					if c.GlobalIsSet(allowOvercommitArgName) {
+						val := c.GlobalBool(allowOvercommitArgName)
+						options.AllowOvercommit = &val
+					}
+					if c.GlobalIsSet(enableDeferredCommitArgName) {
+						val := c.GlobalBool(enableDeferredCommitArgName)
+						options.EnableDeferredCommit = &val
+					}
 
-				if c.GlobalBool(measureArgName) {
-					fmt.Println("Elapsed time:", time.Since(start))
-				}
+					return runWCOW(&options)
+				})
 
 				return nil
 			},
@@ -250,20 +691,141 @@ func main() {
 	}
 }
 
-func run(options *uvm.OptionsLCOW) error {
-	uvm, err := uvm.CreateLCOW(options)
+func run(options *uvm.OptionsLCOW, scsiMounts []scsiMount, shares []shareMount, tty bool, execCommandLine string) (phaseTimings, error) {
+	var t phaseTimings
+	ctx := context.Background()
+
+	createStart := time.Now()
+	vm, err := uvm.CreateLCOW(options)
+	t.CreateMS = msSince(createStart)
 	if err != nil {
-		return err
+		return t, err
+	}
+	defer vm.Close()
+
+	// Mounts are attached before Start so that they're already present by
+	// the time the UVM boots, whether the exec'd command is launched
+	// automatically (ExecCommandLine, baked into options above) or via
+	// runInteractive below once --tty is requested.
+	for _, m := range scsiMounts {
+		sm := m
+		if _, _, err := vm.AddSCSI(ctx, sm.hostPath, sm.uvmPath, sm.readOnly, false, nil, uvm.VMAccessTypeIndividual); err != nil {
+			return t, fmt.Errorf("attaching SCSI disk %s: %s", sm.hostPath, err)
+		}
+		defer func() {
+			if err := vm.RemoveSCSI(ctx, sm.hostPath); err != nil {
+				logrus.WithError(err).Warnf("failed to detach SCSI disk %s", sm.hostPath)
+			}
+		}()
+	}
+
+	for _, s := range shares {
+		sh := s
+		if err := vm.AddPlan9(ctx, sh.hostPath, sh.uvmPath, sh.readOnly, false, nil); err != nil {
+			return t, fmt.Errorf("sharing %s into UVM: %s", sh.hostPath, err)
+		}
+		defer func() {
+			if err := vm.RemovePlan9(ctx, sh.hostPath); err != nil {
+				logrus.WithError(err).Warnf("failed to remove share %s", sh.hostPath)
+			}
+		}()
 	}
-	defer uvm.Close()
 
-	if err := uvm.Start(); err != nil {
-		return err
+	startStart := time.Now()
+	err = vm.Start()
+	t.StartMS = msSince(startStart)
+	if err != nil {
+		return t, err
 	}
 
-	if err := uvm.WaitExpectedError(hcs.ErrVmcomputeUnexpectedExit); err != nil {
-		return err
+	if tty && execCommandLine != "" {
+		// scsiMounts and shares are already attached above, so they're
+		// available for the whole interactive session below.
+		execStart := time.Now()
+		err := runInteractive(ctx, vm, execCommandLine)
+		t.ExecMS = msSince(execStart)
+		if err != nil {
+			return t, err
+		}
+
+		// The interactive command runs as a GCS child process, not the
+		// UVM's init, so its exit doesn't trigger UVM shutdown the way
+		// ExecCommandLine's init process would. Tear the UVM down
+		// ourselves instead of waiting on an exit that will never come.
+		waitStart := time.Now()
+		err = vm.Terminate(ctx)
+		t.WaitMS = msSince(waitStart)
+		return t, err
+	}
+
+	waitStart := time.Now()
+	err = vm.WaitExpectedError(hcs.ErrVmcomputeUnexpectedExit)
+	t.WaitMS = msSince(waitStart)
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// msSince returns the elapsed time since start, in milliseconds.
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
+
+// runInteractive starts commandLine as a process in the UVM with its stdio
+// connected to the GCS, then pumps os.Stdin into the process' stdin and
+// copies the process' stdout/stderr back to the host terminal until it
+// exits. It is used instead of OptionsLCOW.ExecCommandLine when --tty is
+// requested, since that option gives no way to reach the process' stdio.
+func runInteractive(ctx context.Context, vm *uvm.UtilityVM, commandLine string) error {
+	p, err := vm.CreateProcess(ctx, &hcsschema.ProcessParameters{
+		CommandLine:      commandLine,
+		CreateStdInPipe:  true,
+		CreateStdOutPipe: true,
+		CreateStdErrPipe: true,
+	})
+	if err != nil {
+		return fmt.Errorf("creating interactive process: %s", err)
+	}
+	defer p.Close()
+
+	stdin, stdout, stderr := p.Stdio()
+
+	go func() {
+		io.Copy(stdin, os.Stdin)
+		stdin.Close()
+	}()
+	go io.Copy(os.Stdout, stdout)
+	go io.Copy(os.Stderr, stderr)
+
+	return p.Wait()
+}
+
+func runWCOW(options *uvm.OptionsWCOW) (phaseTimings, error) {
+	var t phaseTimings
+
+	createStart := time.Now()
+	vm, err := uvm.CreateWCOW(options)
+	t.CreateMS = msSince(createStart)
+	if err != nil {
+		return t, err
+	}
+	defer vm.Close()
+
+	startStart := time.Now()
+	err = vm.Start()
+	t.StartMS = msSince(startStart)
+	if err != nil {
+		return t, err
+	}
+
+	waitStart := time.Now()
+	err = vm.WaitExpectedError(hcs.ErrVmcomputeUnexpectedExit)
+	t.WaitMS = msSince(waitStart)
+	if err != nil {
+		return t, err
 	}
 
-	return nil
+	return t, nil
 }
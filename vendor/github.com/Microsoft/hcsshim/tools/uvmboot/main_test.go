@@ -0,0 +1,142 @@
+package main
+
+import "testing"
+
+func TestParseSCSIMount(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    scsiMount
+		wantErr bool
+	}{
+		{
+			name: "host path only",
+			in:   `C:\data\disk.vhdx`,
+			want: scsiMount{hostPath: `C:\data\disk.vhdx`},
+		},
+		{
+			name: "drive letter host path with uvm path and readonly",
+			in:   `C:\data\disk.vhdx:/mnt/data:true`,
+			want: scsiMount{hostPath: `C:\data\disk.vhdx`, uvmPath: "/mnt/data", readOnly: true},
+		},
+		{
+			name: "drive letter host path with uvm path",
+			in:   `D:\disk.vhdx:/mnt/data`,
+			want: scsiMount{hostPath: `D:\disk.vhdx`, uvmPath: "/mnt/data"},
+		},
+		{
+			name: "unc host path with readonly",
+			in:   `\\host\share\disk.vhdx:/mnt/data:false`,
+			want: scsiMount{hostPath: `\\host\share\disk.vhdx`, uvmPath: "/mnt/data", readOnly: false},
+		},
+		{
+			name:    "empty host path",
+			in:      ":/mnt/data",
+			wantErr: true,
+		},
+		{
+			name:    "non-bool readonly",
+			in:      `C:\disk.vhdx:/mnt/data:sure`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSCSIMount(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSCSIMount(%q) = %+v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSCSIMount(%q) returned unexpected error: %s", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSCSIMount(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseShare(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    shareMount
+		wantErr bool
+	}{
+		{
+			name: "drive letter host dir with uvm dir and readonly",
+			in:   `C:\data:/mnt/data:true`,
+			want: shareMount{hostPath: `C:\data`, uvmPath: "/mnt/data", readOnly: true},
+		},
+		{
+			name: "drive letter host dir with uvm dir",
+			in:   `C:\data:/mnt/data`,
+			want: shareMount{hostPath: `C:\data`, uvmPath: "/mnt/data"},
+		},
+		{
+			name:    "missing uvm dir",
+			in:      `C:\data`,
+			wantErr: true,
+		},
+		{
+			name:    "non-bool readonly",
+			in:      `C:\data:/mnt/data:sure`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShare(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseShare(%q) = %+v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseShare(%q) returned unexpected error: %s", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseShare(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   phaseSummary
+	}{
+		{
+			name:   "no samples",
+			values: nil,
+			want:   phaseSummary{},
+		},
+		{
+			name:   "single sample",
+			values: []float64{5},
+			want:   phaseSummary{MinMS: 5, MedianMS: 5, P95MS: 5, P99MS: 5, MaxMS: 5},
+		},
+		{
+			name:   "two samples have distinct tail percentiles",
+			values: []float64{10, 20},
+			want:   phaseSummary{MinMS: 10, MedianMS: 15, P95MS: 19.5, P99MS: 19.9, MaxMS: 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(tt.values)
+			if got != tt.want {
+				t.Errorf("summarize(%v) = %+v, want %+v", tt.values, got, tt.want)
+			}
+		})
+	}
+}